@@ -0,0 +1,476 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/qdrant/go-client/qdrant"
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+// goPackageRe pulls the package name out of a Go file's package clause.
+var goPackageRe = regexp.MustCompile(`(?m)^\s*package\s+(\w+)`)
+
+// packageOf scopes call-graph resolution to "things declared near each
+// other": Go gets its real package name, everything else falls back to the
+// containing directory, which is a reasonable proxy for a module/namespace
+// in languages we don't parse a package clause for.
+func packageOf(p *LanguageProvider, path string, content []byte) string {
+	if p.Name == "go" {
+		if m := goPackageRe.FindSubmatch(content); m != nil {
+			return string(m[1])
+		}
+	}
+	return filepath.Dir(path)
+}
+
+// callSite is a call/selector expression's text and the 1-based line it
+// starts on, used to assign it to the enclosing Chunk by line range.
+type callSite struct {
+	Text string
+	Line uint32
+}
+
+// callQueryCache memoizes each provider's compiled CallQuery, mirroring
+// providerCache in languages.go. callQueryCacheMu guards it for the same
+// reason providerCacheMu guards providerCache: watch_project's debounced
+// reindexes run one goroutine per changed file and can race on first use.
+var (
+	callQueryCache   = map[string]*sitter.Query{}
+	callQueryCacheMu sync.Mutex
+)
+
+// extractCallSites runs p's CallQuery (if any) against an already-parsed
+// tree, returning every call expression found in the file.
+func extractCallSites(p *LanguageProvider, tree *sitter.Tree, content []byte) []callSite {
+	if p.CallQuery == "" {
+		return nil
+	}
+
+	callQueryCacheMu.Lock()
+	q, ok := callQueryCache[p.Name]
+	if !ok {
+		var err error
+		q, err = sitter.NewQuery([]byte(p.CallQuery), p.Language)
+		if err != nil {
+			callQueryCacheMu.Unlock()
+			return nil
+		}
+		callQueryCache[p.Name] = q
+	}
+	callQueryCacheMu.Unlock()
+
+	qc := sitter.NewQueryCursor()
+	qc.Exec(q, tree.RootNode())
+
+	var sites []callSite
+	for {
+		match, ok := qc.NextMatch()
+		if !ok {
+			break
+		}
+		for _, capture := range match.Captures {
+			sites = append(sites, callSite{
+				Text: capture.Node.Content(content),
+				Line: capture.Node.StartPoint().Row + 1,
+			})
+		}
+	}
+	return sites
+}
+
+// callsWithin returns the callee names (last segment of any dotted/selector
+// text) for call sites whose line falls inside [startLine, endLine].
+func callsWithin(sites []callSite, startLine, endLine uint32) []string {
+	var names []string
+	for _, site := range sites {
+		if site.Line < startLine || site.Line > endLine {
+			continue
+		}
+		names = append(names, calleeName(site.Text))
+	}
+	return names
+}
+
+// calleeName strips a selector/member-access expression like "pkg.Foo" or
+// "self.bar" down to the final identifier, which is what we resolve against.
+func calleeName(callText string) string {
+	if idx := strings.LastIndexAny(callText, ".:"); idx != -1 {
+		return callText[idx+1:]
+	}
+	return callText
+}
+
+// importQueryCache memoizes each provider's compiled ImportQuery, mirroring
+// callQueryCache above. importQueryCacheMu guards it for the same reason.
+var (
+	importQueryCache   = map[string]*sitter.Query{}
+	importQueryCacheMu sync.Mutex
+)
+
+// extractImports runs p's ImportQuery (if any) against an already-parsed
+// tree, returning the package/module name imported by each match. A Go
+// import of "github.com/foo/bar" or a JS import of "./utils/format" both
+// reduce to their final path segment, which is what calleeName-derived
+// targets are matched against in resolveCallee.
+func extractImports(p *LanguageProvider, tree *sitter.Tree, content []byte) []string {
+	if p.ImportQuery == "" {
+		return nil
+	}
+
+	importQueryCacheMu.Lock()
+	q, ok := importQueryCache[p.Name]
+	if !ok {
+		var err error
+		q, err = sitter.NewQuery([]byte(p.ImportQuery), p.Language)
+		if err != nil {
+			importQueryCacheMu.Unlock()
+			return nil
+		}
+		importQueryCache[p.Name] = q
+	}
+	importQueryCacheMu.Unlock()
+
+	qc := sitter.NewQueryCursor()
+	qc.Exec(q, tree.RootNode())
+
+	var imports []string
+	for {
+		match, ok := qc.NextMatch()
+		if !ok {
+			break
+		}
+		for _, capture := range match.Captures {
+			imports = append(imports, importPackageName(capture.Node.Content(content)))
+		}
+	}
+	return imports
+}
+
+// importPackageName reduces a raw import-query capture (a quoted path
+// literal or a dotted/scoped identifier) to the bare name it's referred to
+// by at call sites, e.g. `"github.com/foo/bar"` and `foo.bar` both become
+// "bar".
+func importPackageName(raw string) string {
+	raw = strings.Trim(raw, `"'`)
+	if idx := strings.LastIndexAny(raw, "/.:"); idx != -1 {
+		raw = raw[idx+1:]
+	}
+	return raw
+}
+
+// graphNode is the call-graph-relevant projection of one indexed Chunk,
+// collected during the walk in handleIndexProject so resolveCallGraph can
+// run once the whole project has been seen.
+type graphNode struct {
+	PointID     *qdrant.PointId
+	Name        string
+	Package     string
+	CallTargets []string
+	// Imports is the set of package names the node's file imports, consulted
+	// by resolveCallee before it falls back to a global name search.
+	Imports []string
+}
+
+// resolveCallGraph maps each node's CallTargets to the deterministic point
+// ID of the callee when the name resolves unambiguously: first against a
+// package the caller's file actually imports, then the caller's own
+// package, and only then a project-wide match if that's unique. It then
+// writes callees/callers back onto each point's payload.
+func resolveCallGraph(ctx context.Context, nodes []graphNode) (int, error) {
+	// byPackageAndName supports the common case (a call to something
+	// declared in the same package); byName is the fallback for
+	// cross-package calls we can't otherwise disambiguate.
+	byPackageAndName := map[string]*qdrant.PointId{}
+	byName := map[string][]*qdrant.PointId{}
+	ambiguous := map[string]bool{}
+
+	for _, n := range nodes {
+		pkgKey := n.Package + "::" + n.Name
+		if _, exists := byPackageAndName[pkgKey]; exists {
+			ambiguous[pkgKey] = true
+		} else {
+			byPackageAndName[pkgKey] = n.PointID
+		}
+		byName[n.Name] = append(byName[n.Name], n.PointID)
+	}
+
+	callers := map[string][]*qdrant.PointId{}
+	callees := map[string][]*qdrant.PointId{}
+	resolved := 0
+
+	for _, n := range nodes {
+		callerKey := n.PointID.GetUuid()
+		for _, target := range n.CallTargets {
+			calleeID := resolveCallee(target, n.Package, n.Imports, byPackageAndName, byName, ambiguous)
+			if calleeID == nil || calleeID.GetUuid() == callerKey {
+				continue
+			}
+			callees[callerKey] = append(callees[callerKey], calleeID)
+			callers[calleeID.GetUuid()] = append(callers[calleeID.GetUuid()], n.PointID)
+			resolved++
+		}
+	}
+
+	if err := writeGraphEdges(ctx, nodes, callees, callers); err != nil {
+		return resolved, err
+	}
+
+	return resolved, nil
+}
+
+// graphEdgeWrite is one node's recomputed edge set, queued for writeGraphEdges.
+type graphEdgeWrite struct {
+	PointID   *qdrant.PointId
+	CalleeIDs []*qdrant.PointId
+	CallerIDs []*qdrant.PointId
+}
+
+// writeGraphEdges diffs each node's recomputed callees/callers against what's
+// already stored and writes only the ones that changed - including clearing a
+// node down to empty lists when every edge it used to have is gone, which a
+// skip-if-empty check would otherwise leave stale forever. Writes fan out
+// across a bounded worker pool, mirroring the pipeline.go pattern, instead of
+// one sequential SetPayload round-trip per node on every index_project run.
+func writeGraphEdges(ctx context.Context, nodes []graphNode, callees, callers map[string][]*qdrant.PointId) error {
+	existing := existingEdges(ctx, nodes)
+
+	var writes []graphEdgeWrite
+	for _, n := range nodes {
+		key := n.PointID.GetUuid()
+		calleeIDs, callerIDs := callees[key], callers[key]
+		prev := existing[key]
+		if existing != nil && sameUUIDSet(prev.Callees, uuidStrings(calleeIDs)) && sameUUIDSet(prev.Callers, uuidStrings(callerIDs)) {
+			continue
+		}
+		writes = append(writes, graphEdgeWrite{PointID: n.PointID, CalleeIDs: calleeIDs, CallerIDs: callerIDs})
+	}
+	if len(writes) == 0 {
+		return nil
+	}
+
+	sem := make(chan struct{}, embedConcurrency)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+
+	for _, w := range writes {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(w graphEdgeWrite) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := setGraphPayload(ctx, w.PointID, w.CalleeIDs, w.CallerIDs); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	return firstErr
+}
+
+// graphEdges is the previously stored callee/caller UUID lists for one point.
+type graphEdges struct {
+	Callees []string
+	Callers []string
+}
+
+// existingEdges batch-fetches the currently stored callees/callers for every
+// node in one round-trip, so writeGraphEdges can skip points whose edge set
+// hasn't actually changed. A fetch error just means nothing is skipped -
+// every node falls through to a write, which is correct if slower.
+func existingEdges(ctx context.Context, nodes []graphNode) map[string]graphEdges {
+	ids := make([]*qdrant.PointId, len(nodes))
+	for i, n := range nodes {
+		ids[i] = n.PointID
+	}
+
+	points, err := qClient.Get(ctx, &qdrant.GetPoints{
+		CollectionName: CollectionName,
+		Ids:            ids,
+		WithPayload:    qdrant.NewWithPayload(true),
+		WithVectors:    qdrant.NewWithVectors(false),
+	})
+	if err != nil {
+		return nil
+	}
+
+	result := make(map[string]graphEdges, len(points))
+	for _, p := range points {
+		payload := p.GetPayload()
+		result[p.GetId().GetUuid()] = graphEdges{
+			Callees: getUUIDList(payload["callees"]),
+			Callers: getUUIDList(payload["callers"]),
+		}
+	}
+	return result
+}
+
+// uuidStrings converts point IDs to their string UUIDs for comparison
+// against the stringified lists read back from payload.
+func uuidStrings(ids []*qdrant.PointId) []string {
+	out := make([]string, len(ids))
+	for i, id := range ids {
+		out[i] = id.GetUuid()
+	}
+	return out
+}
+
+// sameUUIDSet reports whether a and b contain the same UUIDs, ignoring order.
+func sameUUIDSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	counts := make(map[string]int, len(a))
+	for _, v := range a {
+		counts[v]++
+	}
+	for _, v := range b {
+		counts[v]--
+	}
+	for _, c := range counts {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// resolveCallee looks up target against each package the caller's file
+// imports (in import order), then within the caller's own package, and
+// finally project-wide if that name is unique across the whole project.
+func resolveCallee(target, pkg string, imports []string, byPackageAndName map[string]*qdrant.PointId, byName map[string][]*qdrant.PointId, ambiguous map[string]bool) *qdrant.PointId {
+	for _, imp := range imports {
+		impKey := imp + "::" + target
+		if id, ok := byPackageAndName[impKey]; ok && !ambiguous[impKey] {
+			return id
+		}
+	}
+	pkgKey := pkg + "::" + target
+	if id, ok := byPackageAndName[pkgKey]; ok && !ambiguous[pkgKey] {
+		return id
+	}
+	if ids := byName[target]; len(ids) == 1 {
+		return ids[0]
+	}
+	return nil
+}
+
+// setGraphPayload writes the resolved callee/caller UUID lists onto a point.
+func setGraphPayload(ctx context.Context, id *qdrant.PointId, calleeIDs, callerIDs []*qdrant.PointId) error {
+	_, err := qClient.SetPayload(ctx, &qdrant.SetPayloadPoints{
+		CollectionName: CollectionName,
+		Payload: map[string]*qdrant.Value{
+			"callees": uuidListValue(calleeIDs),
+			"callers": uuidListValue(callerIDs),
+		},
+		PointsSelector: qdrant.NewPointsSelectorIDs([]*qdrant.PointId{id}),
+	})
+	return err
+}
+
+// uuidListValue builds a Qdrant list-of-strings payload value from point
+// IDs, the representation codebase_neighbors reads back via getUUIDList.
+func uuidListValue(ids []*qdrant.PointId) *qdrant.Value {
+	values := make([]*qdrant.Value, len(ids))
+	for i, id := range ids {
+		values[i] = qdrant.NewValueString(id.GetUuid())
+	}
+	return &qdrant.Value{
+		Kind: &qdrant.Value_ListValue{
+			ListValue: &qdrant.ListValue{Values: values},
+		},
+	}
+}
+
+// getUUIDList reads back a list-of-strings payload value written by
+// uuidListValue.
+func getUUIDList(v *qdrant.Value) []string {
+	list := v.GetListValue()
+	if list == nil {
+		return nil
+	}
+	ids := make([]string, 0, len(list.Values))
+	for _, item := range list.Values {
+		ids = append(ids, item.GetStringValue())
+	}
+	return ids
+}
+
+// handleCodebaseNeighbors answers codebase_neighbors: a breadth-first walk
+// of the caller/callee graph starting at point_id, out to depth hops.
+func handleCodebaseNeighbors(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	rootUUID, err := request.RequireString("point_id")
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("point_id required: %v", err)), nil
+	}
+	depth := int(request.GetFloat("depth", 1))
+	if depth < 1 {
+		depth = 1
+	}
+
+	subgraph := neighborSubgraph(ctx, rootUUID, depth)
+	return mcp.NewToolResultText(formatNeighbors(subgraph)), nil
+}
+
+// neighborSubgraph BFS-expands callers/callees starting at rootUUID, up to
+// depth hops, returning every point visited (including the root).
+func neighborSubgraph(ctx context.Context, rootUUID string, depth int) []*qdrant.RetrievedPoint {
+	visited := map[string]bool{rootUUID: true}
+	frontier := []string{rootUUID}
+	var subgraph []*qdrant.RetrievedPoint
+
+	for hop := 0; hop <= depth && len(frontier) > 0; hop++ {
+		var next []string
+		for _, id := range frontier {
+			point, ok := fetchPoint(ctx, qdrant.NewIDUUID(id))
+			if !ok {
+				continue
+			}
+			subgraph = append(subgraph, point)
+
+			payload := point.GetPayload()
+			neighbors := append(getUUIDList(payload["callees"]), getUUIDList(payload["callers"])...)
+			for _, neighbor := range neighbors {
+				if !visited[neighbor] {
+					visited[neighbor] = true
+					next = append(next, neighbor)
+				}
+			}
+		}
+		frontier = next
+	}
+
+	return subgraph
+}
+
+// formatNeighbors renders a caller/callee subgraph the way codebase_search
+// renders hits: enough to navigate from, not a dump of every field.
+func formatNeighbors(points []*qdrant.RetrievedPoint) string {
+	if len(points) == 0 {
+		return "No neighbors found."
+	}
+
+	var text string
+	for _, p := range points {
+		payload := p.GetPayload()
+		text += fmt.Sprintf("%s (%s) in %s\n  callers: %v\n  callees: %v\n\n",
+			payload["function"].GetStringValue(),
+			payload["kind"].GetStringValue(),
+			payload["file_path"].GetStringValue(),
+			getUUIDList(payload["callers"]),
+			getUUIDList(payload["callees"]),
+		)
+	}
+	return text
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"sync"
+
+	sitter "github.com/smacker/go-tree-sitter"
+	"github.com/smacker/go-tree-sitter/golang"
+	"github.com/smacker/go-tree-sitter/java"
+	"github.com/smacker/go-tree-sitter/javascript"
+	"github.com/smacker/go-tree-sitter/python"
+	"github.com/smacker/go-tree-sitter/rust"
+	"github.com/smacker/go-tree-sitter/typescript/typescript"
+)
+
+// Chunk is a normalized, language-agnostic unit of indexable code extracted
+// by a LanguageProvider's tree-sitter query.
+type Chunk struct {
+	Kind      string // e.g. "function", "method", "class", "struct", "type"
+	Name      string
+	Body      string
+	StartLine uint32
+	EndLine   uint32
+	Language  string
+
+	// Scope is the name of the innermost enclosing class/struct/impl, if
+	// any, e.g. "UserService" for a method UserService.validate. Grammars
+	// like Python and TS/JS have no separate "method" node distinct from a
+	// plain function, so two classes in the same file that both define
+	// __init__/constructor would otherwise produce identical Kind+Name and
+	// collide on the same point ID; Scope disambiguates them.
+	Scope string
+
+	// Package is the enclosing package/module this chunk belongs to, used to
+	// scope call-graph resolution. See packageOf in graph.go.
+	Package string
+	// CallTargets lists the unresolved names/selectors called from within
+	// this chunk's body, populated from CallQuery matches that fall inside
+	// the chunk's line range. See resolveCallGraph in graph.go.
+	CallTargets []string
+	// Imports lists the packages/modules the chunk's file imports, extracted
+	// once per file via ImportQuery. resolveCallee consults this before
+	// falling back to a project-wide name search, so a call resolves to the
+	// package the caller's file actually imports. See graph.go.
+	Imports []string
+}
+
+// LanguageProvider wires a tree-sitter grammar to the S-expression queries
+// used to pull indexable chunks (functions, methods, classes/structs,
+// top-level type declarations) and call-graph data out of a parsed source
+// file.
+//
+// Query must capture the node to index under a name that becomes the
+// Chunk's Kind (e.g. "@function", "@method", "@class", "@struct") and, when
+// available, the identifier node under "@name".
+//
+// CallQuery and ImportQuery are best-effort: they feed the optional call
+// graph built by resolveCallGraph, not the base index, so a language can
+// leave either blank and still index normally. ImportQuery's matches are
+// reduced to package names and consulted by resolveCallee to disambiguate a
+// call before it falls back to a project-wide name search.
+type LanguageProvider struct {
+	Name        string
+	Language    *sitter.Language
+	Query       string
+	CallQuery   string // captures call sites under @call
+	ImportQuery string // captures imported paths/modules under @import
+}
+
+// languageProviders maps a file extension (including the leading dot) to the
+// LanguageProvider responsible for parsing it. Register new languages here.
+var languageProviders = map[string]*LanguageProvider{
+	".go": {
+		Name:     "go",
+		Language: golang.GetLanguage(),
+		Query: `
+			(function_declaration name: (identifier) @name) @function
+			(method_declaration name: (field_identifier) @name) @method
+			(type_spec name: (type_identifier) @name type: (struct_type)) @struct
+		`,
+		CallQuery: `
+			(call_expression function: (identifier) @call)
+			(call_expression function: (selector_expression) @call)
+		`,
+		ImportQuery: `
+			(import_spec path: (interpreted_string_literal) @import)
+		`,
+	},
+	".py": {
+		Name:     "python",
+		Language: python.GetLanguage(),
+		Query: `
+			(function_definition name: (identifier) @name) @function
+			(class_definition name: (identifier) @name) @class
+		`,
+		CallQuery: `
+			(call function: (identifier) @call)
+			(call function: (attribute) @call)
+		`,
+		ImportQuery: `
+			(import_from_statement module_name: (dotted_name) @import)
+			(import_statement name: (dotted_name) @import)
+		`,
+	},
+	".ts": {
+		Name:     "typescript",
+		Language: typescript.GetLanguage(),
+		Query: `
+			(function_declaration name: (identifier) @name) @function
+			(method_definition name: (property_identifier) @name) @method
+			(class_declaration name: (type_identifier) @name) @class
+		`,
+		CallQuery: `
+			(call_expression function: (identifier) @call)
+			(call_expression function: (member_expression) @call)
+		`,
+		ImportQuery: `
+			(import_statement source: (string) @import)
+		`,
+	},
+	".tsx": {
+		Name:     "typescript",
+		Language: typescript.GetLanguage(),
+		Query: `
+			(function_declaration name: (identifier) @name) @function
+			(method_definition name: (property_identifier) @name) @method
+			(class_declaration name: (type_identifier) @name) @class
+		`,
+		CallQuery: `
+			(call_expression function: (identifier) @call)
+			(call_expression function: (member_expression) @call)
+		`,
+		ImportQuery: `
+			(import_statement source: (string) @import)
+		`,
+	},
+	".js": {
+		Name:     "javascript",
+		Language: javascript.GetLanguage(),
+		Query: `
+			(function_declaration name: (identifier) @name) @function
+			(method_definition name: (property_identifier) @name) @method
+			(class_declaration name: (identifier) @name) @class
+		`,
+		CallQuery: `
+			(call_expression function: (identifier) @call)
+			(call_expression function: (member_expression) @call)
+		`,
+		ImportQuery: `
+			(import_statement source: (string) @import)
+		`,
+	},
+	".jsx": {
+		Name:     "javascript",
+		Language: javascript.GetLanguage(),
+		Query: `
+			(function_declaration name: (identifier) @name) @function
+			(method_definition name: (property_identifier) @name) @method
+			(class_declaration name: (identifier) @name) @class
+		`,
+		CallQuery: `
+			(call_expression function: (identifier) @call)
+			(call_expression function: (member_expression) @call)
+		`,
+		ImportQuery: `
+			(import_statement source: (string) @import)
+		`,
+	},
+	".rs": {
+		Name:     "rust",
+		Language: rust.GetLanguage(),
+		Query: `
+			(function_item name: (identifier) @name) @function
+			(struct_item name: (type_identifier) @name) @struct
+			(impl_item type: (type_identifier) @name) @impl
+		`,
+		CallQuery: `
+			(call_expression function: (identifier) @call)
+			(call_expression function: (field_expression) @call)
+		`,
+		ImportQuery: `
+			(use_declaration argument: (scoped_identifier) @import)
+		`,
+	},
+	".java": {
+		Name:     "java",
+		Language: java.GetLanguage(),
+		Query: `
+			(method_declaration name: (identifier) @name) @method
+			(class_declaration name: (identifier) @name) @class
+		`,
+		CallQuery: `
+			(method_invocation name: (identifier) @call)
+		`,
+		ImportQuery: `
+			(import_declaration (scoped_identifier) @import)
+		`,
+	},
+}
+
+// providerCache memoizes the compiled sitter.Query for each LanguageProvider
+// so every indexed file doesn't re-parse the query text. providerCacheMu
+// guards it since watch_project's debounced reindexes run one goroutine per
+// changed file and can race on first use of a not-yet-cached language.
+var (
+	providerCache   = map[string]*sitter.Query{}
+	providerCacheMu sync.Mutex
+)
+
+// queryForProvider returns the compiled query for p, compiling and caching it
+// on first use.
+func queryForProvider(p *LanguageProvider) (*sitter.Query, error) {
+	providerCacheMu.Lock()
+	defer providerCacheMu.Unlock()
+
+	if q, ok := providerCache[p.Name]; ok {
+		return q, nil
+	}
+	q, err := sitter.NewQuery([]byte(p.Query), p.Language)
+	if err != nil {
+		return nil, err
+	}
+	providerCache[p.Name] = q
+	return q, nil
+}
+
+// extractChunks parses content with p's grammar and query, returning every
+// captured Chunk normalized to the language-agnostic shape the indexing
+// pipeline operates on. path is used only to derive Chunk.Package and to
+// fall back on when a language has no package/module declaration.
+func extractChunks(p *LanguageProvider, path string, content []byte) ([]Chunk, error) {
+	parser := sitter.NewParser()
+	parser.SetLanguage(p.Language)
+	tree := parser.Parse(nil, content)
+
+	q, err := queryForProvider(p)
+	if err != nil {
+		return nil, err
+	}
+
+	qc := sitter.NewQueryCursor()
+	qc.Exec(q, tree.RootNode())
+
+	pkg := packageOf(p, path, content)
+	calls := extractCallSites(p, tree, content)
+	imports := extractImports(p, tree, content)
+
+	var chunks []Chunk
+	for {
+		match, ok := qc.NextMatch()
+		if !ok {
+			break
+		}
+
+		var kind, name, body string
+		var startLine, endLine uint32
+		var kindNode *sitter.Node
+
+		for _, capture := range match.Captures {
+			node := capture.Node
+			captureName := q.CaptureNameForId(capture.Index)
+
+			if captureName == "name" {
+				name = node.Content(content)
+				continue
+			}
+			kind = captureName
+			kindNode = node
+			body = node.Content(content)
+			startLine = node.StartPoint().Row + 1
+			endLine = node.EndPoint().Row + 1
+		}
+
+		if kind == "" {
+			continue
+		}
+
+		chunks = append(chunks, Chunk{
+			Kind:        kind,
+			Name:        name,
+			Body:        body,
+			StartLine:   startLine,
+			EndLine:     endLine,
+			Language:    p.Name,
+			Scope:       enclosingScope(kindNode, content),
+			Package:     pkg,
+			CallTargets: callsWithin(calls, startLine, endLine),
+			Imports:     imports,
+		})
+	}
+
+	return chunks, nil
+}
+
+// enclosingScope walks up from node looking for the nearest ancestor with a
+// "name" field (a class/struct declaration, or an enclosing function for a
+// nested definition), returning that name; a Rust impl block has no "name"
+// field, so its "type" field is used instead. It returns "" for a top-level function, which
+// is indistinguishable from "no enclosing scope" and fine to fold into the
+// point ID as-is.
+func enclosingScope(node *sitter.Node, content []byte) string {
+	if node == nil {
+		return ""
+	}
+	for p := node.Parent(); p != nil; p = p.Parent() {
+		if p.Type() == "impl_item" {
+			if typeNode := p.ChildByFieldName("type"); typeNode != nil {
+				return typeNode.Content(content)
+			}
+		}
+		if nameNode := p.ChildByFieldName("name"); nameNode != nil {
+			return nameNode.Content(content)
+		}
+	}
+	return ""
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io/fs"
 	"log"
@@ -11,20 +13,25 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/bytedance/sonic"
 	"github.com/google/uuid"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
 	"github.com/qdrant/go-client/qdrant"
-	sitter "github.com/smacker/go-tree-sitter"
-	"github.com/smacker/go-tree-sitter/golang"
 )
 
 const (
 	// Update this to match qwen3-embedding's exact output dimension (e.g., 3584, 4096, etc.)
 	VectorDimension = 4096 // https://huggingface.co/Qwen/Qwen3-Embedding-8B
 	CollectionName  = "codebase_index"
+
+	// Named vectors stored per point: DenseVectorName is the qwen3-embedding
+	// similarity vector, SparseVectorName is the BM25-style term-frequency
+	// vector produced by sparse.go.
+	DenseVectorName  = "dense"
+	SparseVectorName = "sparse"
 )
 
 // Global variables for our configuration
@@ -32,6 +39,11 @@ var (
 	ollamaURL      string
 	embeddingModel string
 	qClient        *qdrant.Client
+	mcpServer      *server.MCPServer
+
+	embedConcurrency int
+	embeddingBatch   int
+	upsertBatchSize  int
 )
 
 func main() {
@@ -41,6 +53,9 @@ func main() {
 	// 1. Read Environment Variables injected by the MCP client config
 	ollamaURL = getEnvOrDefault("OLLAMA_URL", "http://localhost:11434")
 	embeddingModel = getEnvOrDefault("EMBEDDING_MODEL", "qwen3-embedding:8b")
+	embedConcurrency = getEnvOrDefaultInt("EMBED_CONCURRENCY", 4)
+	embeddingBatch = getEnvOrDefaultInt("EMBEDDING_BATCH", 1)
+	upsertBatchSize = getEnvOrDefaultInt("UPSERT_BATCH", 64)
 
 	qdrantHost := getEnvOrDefault("QDRANT_HOST", "localhost")
 	qdrantPortStr := getEnvOrDefault("QDRANT_PORT", "6334")
@@ -67,70 +82,50 @@ func main() {
 
 	// 3. Initialize MCP Server
 	s := server.NewMCPServer("go-codebase-indexer", "1.0.0")
+	mcpServer = s
 
 	// --- Tool 1: Index Project ---
 	indexTool := mcp.NewTool("index_project",
-		mcp.WithDescription("Scans the project, parses Go files, and indexes functions into Qdrant."),
+		mcp.WithDescription("Scans the project, parses source files across supported languages, and indexes functions/methods/classes into Qdrant."),
 		mcp.WithString("path", mcp.Required(), mcp.Description("Absolute path to the project root")),
 	)
 	s.AddTool(indexTool, handleIndexProject)
 
 	// 4. Define the Search Tool
 	searchTool := mcp.NewTool("codebase_search",
-		mcp.WithDescription("Semantic search across the codebase using AI embeddings."),
+		mcp.WithDescription("Hybrid (dense + sparse BM25-style) search across the codebase."),
 		mcp.WithString("query", mcp.Description("Natural language query")),
 		mcp.WithNumber("limit", mcp.Description("Max results to return")),
+		mcp.WithString("language", mcp.Description("Optional: restrict results to a language (e.g. go, python, typescript, rust, java)")),
+		mcp.WithString("kind", mcp.Description("Optional: restrict results to a chunk kind (e.g. function, method, class, struct)")),
+		mcp.WithString("mode", mcp.Description("Search mode: dense, sparse, or hybrid (default hybrid)")),
+		mcp.WithNumber("alpha", mcp.Description("Optional: weight given to the dense vector in hybrid mode, 0-1; when omitted, hybrid mode uses reciprocal rank fusion instead")),
+		mcp.WithBoolean("expand_neighbors", mcp.Description("Optional: append each hit's immediate callers/callees")),
 	)
 
 	// 5. Add Tool Handler
-	s.AddTool(searchTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		// A. Extract 'query' using the new type-safe helper (returns string, error)
-		query, err := request.RequireString("query")
-		if err != nil {
-			// MCP Go v0.43+ provides NewToolResultError for graceful argument failures
-			return mcp.NewToolResultError(fmt.Sprintf("Invalid or missing 'query': %v", err)), nil
-		}
-
-		// B. Extract 'limit' using the type-safe helper with a default value of 20
-		// JSON numbers are parsed as float64, so we get it as a float and cast it
-		limitFloat := request.GetFloat("limit", 20.0)
-		limit := uint64(limitFloat)
-
-		// C. Get embedding from local Ollama
-		queryVector, err := getOllamaEmbedding(query)
-		if err != nil {
-			return mcp.NewToolResultError(fmt.Sprintf("Ollama error: %v", err)), nil
-		}
-
-		// D. Search Qdrant
-		searchResults, err := qClient.Query(ctx, &qdrant.QueryPoints{
-			CollectionName: CollectionName,
-			Query:          qdrant.NewQuery(queryVector...),
-			Limit:          &limit,
-			WithPayload:    qdrant.NewWithPayload(true),
-		})
-		if err != nil {
-			return mcp.NewToolResultError(fmt.Sprintf("Qdrant search error: %v", err)), nil
-		}
-
-		// E. Format results for Claude
-		var responseText string
-		for _, point := range searchResults {
-			payload := point.GetPayload()
-			filePath := payload["file_path"].GetStringValue()
-			lineNum := payload["line_number"].GetIntegerValue()
-			codeSnippet := payload["code_snippet"].GetStringValue()
+	s.AddTool(searchTool, handleCodebaseSearch)
 
-			responseText += fmt.Sprintf("File: %s (Line: %d)\nScore: %.3f\n```go\n%s\n```\n\n---\n",
-				filePath, lineNum, point.GetScore(), codeSnippet)
-		}
+	// --- Tool: Codebase Neighbors ---
+	neighborsTool := mcp.NewTool("codebase_neighbors",
+		mcp.WithDescription("Returns the k-hop caller/callee subgraph around a point from codebase_search."),
+		mcp.WithString("point_id", mcp.Required(), mcp.Description("Point UUID, as returned in a codebase_search hit")),
+		mcp.WithNumber("depth", mcp.Description("Number of hops to expand (default 1)")),
+	)
+	s.AddTool(neighborsTool, handleCodebaseNeighbors)
 
-		if responseText == "" {
-			responseText = "No relevant code found."
-		}
+	// --- Tool 3: Watch / Unwatch Project ---
+	watchTool := mcp.NewTool("watch_project",
+		mcp.WithDescription("Watches a project root and incrementally reindexes files as they change."),
+		mcp.WithString("path", mcp.Required(), mcp.Description("Absolute path to the project root")),
+	)
+	s.AddTool(watchTool, handleWatchProject)
 
-		return mcp.NewToolResultText(responseText), nil
-	})
+	unwatchTool := mcp.NewTool("unwatch_project",
+		mcp.WithDescription("Stops a watch previously started with watch_project."),
+		mcp.WithString("path", mcp.Required(), mcp.Description("Absolute path passed to watch_project")),
+	)
+	s.AddTool(unwatchTool, handleUnwatchProject)
 
 	// Start listening on stdio for VSCode MCP
 	fmt.Println("Starting Qdrant MCP Indexer on stdio...")
@@ -149,9 +144,18 @@ func ensureCollection(ctx context.Context, client *qdrant.Client) {
 	if !exists {
 		err = client.CreateCollection(ctx, &qdrant.CreateCollection{
 			CollectionName: CollectionName,
-			VectorsConfig: qdrant.NewVectorsConfig(&qdrant.VectorParams{
-				Size:     VectorDimension,
-				Distance: qdrant.Distance_Cosine,
+			// "dense" holds the qwen3-embedding vector used for semantic
+			// similarity; "sparse" holds an in-process BM25-style
+			// term-frequency vector used for exact identifier/keyword
+			// matches. codebase_search fuses the two with FusionRRF.
+			VectorsConfig: qdrant.NewVectorsConfigMap(map[string]*qdrant.VectorParams{
+				DenseVectorName: {
+					Size:     VectorDimension,
+					Distance: qdrant.Distance_Cosine,
+				},
+			}),
+			SparseVectorsConfig: qdrant.NewSparseVectorsConfig(map[string]*qdrant.SparseVectorParams{
+				SparseVectorName: {},
 			}),
 		})
 		if err != nil {
@@ -161,10 +165,11 @@ func ensureCollection(ctx context.Context, client *qdrant.Client) {
 	}
 }
 
-// The request payload for Ollama
+// The request payload for Ollama. Input accepts either a single string or a
+// []string so callers can amortize model load time via Ollama's batch form.
 type OllamaEmbedRequest struct {
 	Model string `json:"model"`
-	Input string `json:"input"`
+	Input any    `json:"input"`
 }
 
 // Your provided response format (renamed for clarity)
@@ -224,6 +229,53 @@ func getOllamaEmbedding(text string) ([]float32, error) {
 	return float32Vector, nil
 }
 
+// getOllamaEmbeddings embeds a batch of texts in a single Ollama round-trip
+// using the API's array `input` form, amortizing model load time across the
+// batch. The returned slice preserves the input order.
+func getOllamaEmbeddings(texts []string) ([][]float32, error) {
+	reqBody := OllamaEmbedRequest{
+		Model: embeddingModel,
+		Input: texts,
+	}
+
+	jsonData, err := sonic.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	resp, err := http.Post(ollamaURL, "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to call Ollama API: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ollama API returned status: %d", resp.StatusCode)
+	}
+
+	var embedResp OllamaEmbedResponse
+	if err := sonic.ConfigDefault.NewDecoder(resp.Body).Decode(&embedResp); err != nil {
+		return nil, fmt.Errorf("failed to decode ollama response: %w", err)
+	}
+
+	if len(embedResp.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("ollama returned %d embeddings for %d inputs", len(embedResp.Embeddings), len(texts))
+	}
+
+	vectors := make([][]float32, len(embedResp.Embeddings))
+	for i, float64Vector := range embedResp.Embeddings {
+		vector := make([]float32, len(float64Vector))
+		for j, val := range float64Vector {
+			vector[j] = float32(val)
+		}
+		vectors[i] = vector
+	}
+
+	return vectors, nil
+}
+
 // Helper to gracefully fallback if the env var isn't present
 func getEnvOrDefault(key, fallback string) string {
 	if value, exists := os.LookupEnv(key); exists {
@@ -232,6 +284,21 @@ func getEnvOrDefault(key, fallback string) string {
 	return fallback
 }
 
+// getEnvOrDefaultInt is the integer-typed counterpart of getEnvOrDefault, used
+// for tunables like EMBED_CONCURRENCY that must parse to a positive int.
+func getEnvOrDefaultInt(key string, fallback int) int {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		log.Printf("Invalid %s=%q, falling back to %d", key, value, fallback)
+		return fallback
+	}
+	return n
+}
+
 // ---------------------------------------------------------
 // Tool Handler: Index Project (Tree-sitter Integration)
 // ---------------------------------------------------------
@@ -243,41 +310,44 @@ func handleIndexProject(ctx context.Context, request mcp.CallToolRequest) (*mcp.
 	}
 
 	stats := struct {
-		Files   int
-		Chunks  int
-		Skipped int
-		Failed  int
+		Files      int
+		Chunks     int
+		Skipped    int
+		Failed     int
+		Reused     int
+		Reembedded int
+		Pruned     int
 	}{}
 
-	// Initialize Tree-sitter Parser for Go
-	parser := sitter.NewParser()
-	parser.SetLanguage(golang.GetLanguage())
-
-	// S-Expression Query to find functions and methods
-	// Capture the function body (@func) and the name (@name)
-	queryStr := `
-		(function_declaration
-			name: (identifier) @name
-		) @func
-		(method_declaration
-			name: (field_identifier) @name
-		) @func
-	`
-	q, _ := sitter.NewQuery([]byte(queryStr), golang.GetLanguage())
+	// Track every point UUID touched during this run so that, once the walk
+	// is done, anything still in Qdrant under rootPath but not seen here
+	// (renamed functions, deleted files) can be pruned.
+	var seenIDs []*qdrant.PointId
+
+	// Collected regardless of reuse/reembed, since the call graph needs to
+	// reflect every chunk currently in the project, not just the ones that
+	// changed this run.
+	var graphNodes []graphNode
+
+	pipeline := newEmbedPipeline(ctx)
 
 	err = filepath.WalkDir(rootPath, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
 
-		// Filter directories and non-Go files
+		// Filter directories
 		if d.IsDir() {
-			if strings.HasPrefix(d.Name(), ".") || d.Name() == "node_modules" || d.Name() == "vendor" {
+			if shouldSkipDir(d.Name()) {
 				return filepath.SkipDir
 			}
 			return nil
 		}
-		if filepath.Ext(path) != ".go" {
+
+		// Dispatch by extension to the registered LanguageProvider, skipping
+		// anything we don't have a grammar for.
+		provider, ok := languageProviders[filepath.Ext(path)]
+		if !ok {
 			stats.Skipped++
 			return nil
 		}
@@ -290,78 +360,182 @@ func handleIndexProject(ctx context.Context, request mcp.CallToolRequest) (*mcp.
 		}
 		stats.Files++
 
-		// Parse with Tree-sitter
-		tree := parser.Parse(nil, content)
-		qc := sitter.NewQueryCursor()
-		qc.Exec(q, tree.RootNode())
-
-		// Iterate over matches (Functions/Methods)
-		for {
-			match, ok := qc.NextMatch()
-			if !ok {
-				break
-			}
+		chunks, err := extractChunks(provider, path, content)
+		if err != nil {
+			stats.Failed++
+			return nil
+		}
 
-			// Extract details
-			var funcName, funcBody string
-			var startLine, endLine uint32
+		for _, chunk := range chunks {
+			// Create Deterministic UUID (Namespace + FilePath + Kind + Scope + Name).
+			// Scope (the enclosing class/struct/impl, if any) is required: grammars
+			// like Python and TS/JS give a method the same Kind as a plain function,
+			// so two classes in one file both declaring __init__/constructor would
+			// otherwise collide on the same ID and silently overwrite each other.
+			// This ensures re-indexing updates the existing record instead of creating duplicates.
+			uniqueID := uuid.NewSHA1(uuid.NameSpaceURL, []byte(path+":"+chunk.Kind+":"+chunk.Scope+":"+chunk.Name)).String()
+			pointID := qdrant.NewIDUUID(uniqueID)
+			seenIDs = append(seenIDs, pointID)
+			graphNodes = append(graphNodes, graphNode{
+				PointID:     pointID,
+				Name:        chunk.Name,
+				Package:     chunk.Package,
+				CallTargets: chunk.CallTargets,
+				Imports:     chunk.Imports,
+			})
 
-			for _, capture := range match.Captures {
-				node := capture.Node
-				name := q.CaptureNameForId(capture.Index)
+			contentHash := hashContent(chunk.Body)
+			indexedAt := time.Now().UTC().Format(time.RFC3339)
 
-				if name == "func" {
-					funcBody = node.Content(content)
-					startLine = node.StartPoint().Row + 1 // 1-based line number for editors
-					endLine = node.EndPoint().Row + 1
-				} else if name == "name" {
-					funcName = node.Content(content)
+			// Skip re-embedding when the existing point's content_hash still
+			// matches, which is the common case on repeat indexing runs.
+			if existing, ok := fetchPoint(ctx, pointID); ok {
+				if existing.GetPayload()["content_hash"].GetStringValue() == contentHash {
+					stats.Reused++
+					stats.Chunks++
+					continue
 				}
 			}
 
-			// Generate Embedding
-			embedding, err := getOllamaEmbedding(funcBody)
-			if err != nil {
-				stats.Failed++
-				continue
-			}
-
-			// Create Deterministic UUID (Namespace + FilePath + FunctionName)
-			// This ensures re-indexing updates the existing record instead of creating duplicates.
-			uniqueID := uuid.NewSHA1(uuid.NameSpaceURL, []byte(path+":"+funcName)).String()
-
-			// Upsert to Qdrant
-			pointID := qdrant.NewIDUUID(uniqueID)
-			_, err = qClient.Upsert(ctx, &qdrant.UpsertPoints{
-				CollectionName: CollectionName,
-				Points: []*qdrant.PointStruct{
-					{
-						Id:      pointID,
-						Vectors: qdrant.NewVectors(embedding...),
-						Payload: map[string]*qdrant.Value{
-							"file_path":    qdrant.NewValueString(path),
-							"function":     qdrant.NewValueString(funcName),
-							"line_start":   qdrant.NewValueInt(int64(startLine)),
-							"line_end":     qdrant.NewValueInt(int64(endLine)),
-							"code_snippet": qdrant.NewValueString(funcBody),
-						},
-					},
-				},
+			// Hand off to the embedding pipeline: a bounded worker pool calls
+			// Ollama (batched when EMBEDDING_BATCH>1) and an upsert batcher
+			// flushes points to Qdrant in groups of UPSERT_BATCH.
+			pipeline.submit(embedJob{
+				Path:        path,
+				Chunk:       chunk,
+				PointID:     pointID,
+				ContentHash: contentHash,
+				IndexedAt:   indexedAt,
 			})
-
-			if err != nil {
-				log.Printf("Qdrant upsert error: %v", err)
-				stats.Failed++
-			} else {
-				stats.Chunks++
-			}
 		}
 
 		return nil
 	})
+	if err != nil {
+		pipeline.close()
+		return mcp.NewToolResultError(fmt.Sprintf("Walk failed: %v", err)), nil
+	}
+
+	reembedded, pipelineFailed := pipeline.close()
+	stats.Reembedded = reembedded
+	stats.Failed += pipelineFailed
+	stats.Chunks += stats.Reembedded
+
+	// Prune anything still under rootPath that wasn't touched by this run:
+	// renamed functions and deleted files no longer matching any seen UUID.
+	pruned, err := pruneOrphans(ctx, rootPath, seenIDs)
+	if err != nil {
+		log.Printf("Orphan pruning error: %v", err)
+	} else {
+		stats.Pruned = pruned
+	}
+
+	resolvedEdges, err := resolveCallGraph(ctx, graphNodes)
+	if err != nil {
+		log.Printf("Call graph resolution error: %v", err)
+	}
 
 	return mcp.NewToolResultText(fmt.Sprintf(
-		"Indexing Complete.\nFiles Scanned: %d\nFunctions Indexed: %d\nFailed/Skipped: %d/%d",
-		stats.Files, stats.Chunks, stats.Failed, stats.Skipped,
+		"Indexing Complete.\nFiles Scanned: %d\nFunctions Indexed: %d\nReused: %d | Reembedded: %d | Pruned: %d\nCall Edges Resolved: %d\nFailed/Skipped: %d/%d",
+		stats.Files, stats.Chunks, stats.Reused, stats.Reembedded, stats.Pruned, resolvedEdges, stats.Failed, stats.Skipped,
 	)), nil
 }
+
+// hashContent returns the hex-encoded SHA-256 digest of a chunk's body, used
+// to detect unchanged functions across indexing runs.
+func hashContent(body string) string {
+	sum := sha256.Sum256([]byte(body))
+	return hex.EncodeToString(sum[:])
+}
+
+// fetchPoint looks up an existing point by its deterministic ID without
+// fetching its vector, so callers can cheaply compare content_hash before
+// deciding whether to re-embed.
+func fetchPoint(ctx context.Context, id *qdrant.PointId) (*qdrant.RetrievedPoint, bool) {
+	points, err := qClient.Get(ctx, &qdrant.GetPoints{
+		CollectionName: CollectionName,
+		Ids:            []*qdrant.PointId{id},
+		WithPayload:    qdrant.NewWithPayload(true),
+		WithVectors:    qdrant.NewWithVectors(false),
+	})
+	if err != nil || len(points) == 0 {
+		return nil, false
+	}
+	return points[0], true
+}
+
+// pruneOrphans deletes every point whose file_path falls under rootPath but
+// whose ID wasn't touched during the current indexing run, which covers
+// renamed functions and deleted files.
+//
+// "Under rootPath" is a path-prefix check done client-side after scrolling
+// the collection: Qdrant's NewMatchText tokenizes on non-alphanumeric
+// boundaries, so a full-text condition on rootPath would also match
+// unrelated sibling projects whose path happens to share the same tokens
+// (e.g. "/data/repos/foo" matching "/data/repos/foo-bar"). Scrolling and
+// filtering in Go avoids that false-positive deletion risk.
+func pruneOrphans(ctx context.Context, rootPath string, seenIDs []*qdrant.PointId) (int, error) {
+	rootPath = filepath.Clean(rootPath)
+
+	seen := make(map[string]bool, len(seenIDs))
+	for _, id := range seenIDs {
+		seen[id.GetUuid()] = true
+	}
+
+	var toDelete []*qdrant.PointId
+	var offset *qdrant.PointId
+	const scrollPageSize = 256
+
+	for {
+		limit := uint32(scrollPageSize)
+		points, err := qClient.Scroll(ctx, &qdrant.ScrollPoints{
+			CollectionName: CollectionName,
+			Limit:          &limit,
+			Offset:         offset,
+			WithPayload:    qdrant.NewWithPayload(true),
+			WithVectors:    qdrant.NewWithVectors(false),
+		})
+		if err != nil {
+			return 0, err
+		}
+		if len(points) == 0 {
+			break
+		}
+
+		for _, p := range points {
+			id := p.GetId()
+			if seen[id.GetUuid()] {
+				continue
+			}
+			if isUnderRoot(p.GetPayload()["file_path"].GetStringValue(), rootPath) {
+				toDelete = append(toDelete, id)
+			}
+		}
+
+		if len(points) < scrollPageSize {
+			break
+		}
+		offset = points[len(points)-1].GetId()
+	}
+
+	if len(toDelete) == 0 {
+		return 0, nil
+	}
+
+	if _, err := qClient.Delete(ctx, &qdrant.DeletePoints{
+		CollectionName: CollectionName,
+		Points:         qdrant.NewPointsSelectorIDs(toDelete),
+	}); err != nil {
+		return 0, err
+	}
+
+	return len(toDelete), nil
+}
+
+// isUnderRoot reports whether filePath is root itself or a descendant of it,
+// a plain string-prefix check on the directory boundary rather than a
+// tokenized full-text match.
+func isUnderRoot(filePath, root string) bool {
+	filePath = filepath.Clean(filePath)
+	return filePath == root || strings.HasPrefix(filePath, root+string(filepath.Separator))
+}
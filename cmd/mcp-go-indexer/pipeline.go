@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/qdrant/go-client/qdrant"
+)
+
+// upsertFlushInterval bounds how long a partially-filled upsert batch can sit
+// before being flushed, so a slow tail of the walk doesn't strand a handful
+// of points until the next full batch arrives.
+const upsertFlushInterval = 2 * time.Second
+
+// progressTokenSeq hands out the incremental tokens used in
+// "notifications/progress" payloads so the MCP client can tell distinct
+// index_project runs apart.
+var progressTokenSeq int64
+
+func nextProgressToken() int64 {
+	return atomic.AddInt64(&progressTokenSeq, 1)
+}
+
+// embedJob is a Chunk queued for (re-)embedding, carrying everything the
+// worker pool needs to build the resulting PointStruct.
+type embedJob struct {
+	Path        string
+	Chunk       Chunk
+	PointID     *qdrant.PointId
+	ContentHash string
+	IndexedAt   string
+}
+
+// embedPipeline fans a stream of embedJobs out across a bounded worker pool,
+// batching calls to Ollama, and fans the resulting points back in through a
+// single upsert batcher so Qdrant sees few, large writes instead of one per
+// function. Progress is streamed to the MCP client as jobs are upserted.
+type embedPipeline struct {
+	jobs   chan embedJob
+	points chan *qdrant.PointStruct
+
+	workers sync.WaitGroup
+	batcher sync.WaitGroup
+
+	progressToken int64
+
+	mu         sync.Mutex
+	reembedded int
+	failed     int
+}
+
+// newEmbedPipeline starts the worker pool and upsert batcher, both of which
+// run until close drains the channels.
+func newEmbedPipeline(ctx context.Context) *embedPipeline {
+	p := &embedPipeline{
+		jobs:          make(chan embedJob, embedConcurrency*embeddingBatch),
+		points:        make(chan *qdrant.PointStruct, upsertBatchSize),
+		progressToken: nextProgressToken(),
+	}
+
+	for i := 0; i < embedConcurrency; i++ {
+		p.workers.Add(1)
+		go p.embedWorker(ctx)
+	}
+
+	p.batcher.Add(1)
+	go p.upsertBatcher(ctx)
+
+	return p
+}
+
+// submit enqueues a job for embedding, blocking if every worker is busy.
+func (p *embedPipeline) submit(job embedJob) {
+	p.jobs <- job
+}
+
+// close stops accepting new jobs, waits for the worker pool and batcher to
+// drain, and returns the final reembedded/failed counts.
+func (p *embedPipeline) close() (reembedded, failed int) {
+	close(p.jobs)
+	p.workers.Wait()
+	close(p.points)
+	p.batcher.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.reembedded, p.failed
+}
+
+// embedWorker pulls jobs off the channel, opportunistically draining up to
+// embeddingBatch-1 more without blocking so it can call Ollama's batch
+// `input: [...]` form, then pushes a PointStruct per chunk onto p.points.
+func (p *embedPipeline) embedWorker(ctx context.Context) {
+	defer p.workers.Done()
+
+	for job := range p.jobs {
+		batch := []embedJob{job}
+		for len(batch) < embeddingBatch {
+			select {
+			case next, ok := <-p.jobs:
+				if !ok {
+					break
+				}
+				batch = append(batch, next)
+				continue
+			default:
+			}
+			break
+		}
+
+		vectors, err := p.embedBatch(batch)
+		if err != nil {
+			log.Printf("Embedding error: %v", err)
+			p.mu.Lock()
+			p.failed += len(batch)
+			p.mu.Unlock()
+			continue
+		}
+
+		for i, j := range batch {
+			p.points <- &qdrant.PointStruct{
+				Id:      j.PointID,
+				Vectors: namedVectors(vectors[i], j.Chunk.Body),
+				Payload: map[string]*qdrant.Value{
+					"file_path":    qdrant.NewValueString(j.Path),
+					"function":     qdrant.NewValueString(j.Chunk.Name),
+					"line_start":   qdrant.NewValueInt(int64(j.Chunk.StartLine)),
+					"line_end":     qdrant.NewValueInt(int64(j.Chunk.EndLine)),
+					"code_snippet": qdrant.NewValueString(j.Chunk.Body),
+					"language":     qdrant.NewValueString(j.Chunk.Language),
+					"kind":         qdrant.NewValueString(j.Chunk.Kind),
+					"content_hash": qdrant.NewValueString(j.ContentHash),
+					"indexed_at":   qdrant.NewValueString(j.IndexedAt),
+				},
+			}
+		}
+
+		p.mu.Lock()
+		p.reembedded += len(batch)
+		p.mu.Unlock()
+	}
+}
+
+// embedBatch calls Ollama once for the whole batch when embeddingBatch>1,
+// falling back to the single-text endpoint otherwise.
+func (p *embedPipeline) embedBatch(batch []embedJob) ([][]float32, error) {
+	if len(batch) == 1 {
+		vector, err := getOllamaEmbedding(batch[0].Chunk.Body)
+		if err != nil {
+			return nil, err
+		}
+		return [][]float32{vector}, nil
+	}
+
+	texts := make([]string, len(batch))
+	for i, j := range batch {
+		texts[i] = j.Chunk.Body
+	}
+	return getOllamaEmbeddings(texts)
+}
+
+// upsertBatcher accumulates points until upsertBatchSize is reached or
+// upsertFlushInterval elapses with a non-empty buffer, then issues a single
+// Qdrant upsert and emits a progress notification.
+func (p *embedPipeline) upsertBatcher(ctx context.Context) {
+	defer p.batcher.Done()
+
+	ticker := time.NewTicker(upsertFlushInterval)
+	defer ticker.Stop()
+
+	var buf []*qdrant.PointStruct
+	total := 0
+
+	flush := func() {
+		if len(buf) == 0 {
+			return
+		}
+		if _, err := qClient.Upsert(ctx, &qdrant.UpsertPoints{
+			CollectionName: CollectionName,
+			Points:         buf,
+		}); err != nil {
+			log.Printf("Qdrant batch upsert error: %v", err)
+		}
+		total += len(buf)
+		sendProgress(ctx, p.progressToken, total, "indexing")
+		buf = nil
+	}
+
+	for {
+		select {
+		case point, ok := <-p.points:
+			if !ok {
+				flush()
+				return
+			}
+			buf = append(buf, point)
+			if len(buf) >= upsertBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// sendProgress best-effort notifies the MCP client of indexing progress.
+// Failures are logged, not surfaced, since progress updates are advisory.
+func sendProgress(ctx context.Context, token int64, progress int, message string) {
+	if mcpServer == nil {
+		return
+	}
+	err := mcpServer.SendNotificationToClient(ctx, "notifications/progress", map[string]any{
+		"progressToken": token,
+		"progress":      progress,
+		"message":       message,
+	})
+	if err != nil {
+		log.Printf("Progress notification error: %v", err)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/qdrant/go-client/qdrant"
+)
+
+// handleCodebaseSearch answers codebase_search, supporting dense-only,
+// sparse-only, and hybrid (RRF-fused or alpha-weighted) retrieval depending
+// on the 'mode' and 'alpha' arguments.
+func handleCodebaseSearch(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	query, err := request.RequireString("query")
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid or missing 'query': %v", err)), nil
+	}
+
+	limit := uint64(request.GetFloat("limit", 20.0))
+	mode := request.GetString("mode", "hybrid")
+	alpha := request.GetFloat("alpha", -1)
+
+	// Build an optional filter from 'language' and 'kind'
+	var conditions []*qdrant.Condition
+	if language := request.GetString("language", ""); language != "" {
+		conditions = append(conditions, qdrant.NewMatch("language", language))
+	}
+	if kind := request.GetString("kind", ""); kind != "" {
+		conditions = append(conditions, qdrant.NewMatch("kind", kind))
+	}
+	var filter *qdrant.Filter
+	if len(conditions) > 0 {
+		filter = &qdrant.Filter{Must: conditions}
+	}
+
+	denseVector, err := getOllamaEmbedding(query)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Ollama error: %v", err)), nil
+	}
+	sparseIdx, sparseVal := sparseVector(query)
+
+	var results []*qdrant.ScoredPoint
+	switch mode {
+	case "dense":
+		results, err = denseSearch(ctx, denseVector, filter, limit)
+	case "sparse":
+		results, err = sparseSearch(ctx, sparseIdx, sparseVal, filter, limit)
+	default:
+		if alpha >= 0 {
+			results, err = weightedHybridSearch(ctx, denseVector, sparseIdx, sparseVal, filter, limit, alpha)
+		} else {
+			results, err = fusionHybridSearch(ctx, denseVector, sparseIdx, sparseVal, filter, limit)
+		}
+	}
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Qdrant search error: %v", err)), nil
+	}
+
+	responseText := formatSearchResults(results, request.GetBool("expand_neighbors", false))
+	return mcp.NewToolResultText(responseText), nil
+}
+
+// formatSearchResults renders scored points the way the MCP client displays
+// them: file location, point ID, language/kind, score, and the indexed
+// snippet. When expandNeighbors is set, each hit's immediate callers/callees
+// are appended.
+func formatSearchResults(results []*qdrant.ScoredPoint, expandNeighbors bool) string {
+	var responseText string
+	for _, point := range results {
+		payload := point.GetPayload()
+		filePath := payload["file_path"].GetStringValue()
+		lineNum := payload["line_start"].GetIntegerValue()
+		codeSnippet := payload["code_snippet"].GetStringValue()
+		language := payload["language"].GetStringValue()
+		kind := payload["kind"].GetStringValue()
+
+		responseText += fmt.Sprintf("File: %s (Line: %d)\nID: %s\nLanguage: %s | Kind: %s\nScore: %.3f\n```\n%s\n```\n",
+			filePath, lineNum, point.GetId().GetUuid(), language, kind, point.GetScore(), codeSnippet)
+
+		if expandNeighbors {
+			callers := getUUIDList(payload["callers"])
+			callees := getUUIDList(payload["callees"])
+			if len(callers) > 0 || len(callees) > 0 {
+				responseText += fmt.Sprintf("Callers: %v\nCallees: %v\n", callers, callees)
+			}
+		}
+
+		responseText += "\n---\n"
+	}
+	if responseText == "" {
+		responseText = "No relevant code found."
+	}
+	return responseText
+}
+
+func denseSearch(ctx context.Context, vector []float32, filter *qdrant.Filter, limit uint64) ([]*qdrant.ScoredPoint, error) {
+	return qClient.Query(ctx, &qdrant.QueryPoints{
+		CollectionName: CollectionName,
+		Query:          qdrant.NewQuery(vector...),
+		Using:          ptr(DenseVectorName),
+		Filter:         filter,
+		Limit:          &limit,
+		WithPayload:    qdrant.NewWithPayload(true),
+	})
+}
+
+func sparseSearch(ctx context.Context, indices []uint32, values []float32, filter *qdrant.Filter, limit uint64) ([]*qdrant.ScoredPoint, error) {
+	return qClient.Query(ctx, &qdrant.QueryPoints{
+		CollectionName: CollectionName,
+		Query:          qdrant.NewQuerySparse(indices, values),
+		Using:          ptr(SparseVectorName),
+		Filter:         filter,
+		Limit:          &limit,
+		WithPayload:    qdrant.NewWithPayload(true),
+	})
+}
+
+// fusionHybridSearch lets Qdrant itself reciprocal-rank-fuse the dense and
+// sparse prefetch results, which is the default (no alpha given) hybrid path.
+func fusionHybridSearch(ctx context.Context, denseVector []float32, sparseIdx []uint32, sparseVal []float32, filter *qdrant.Filter, limit uint64) ([]*qdrant.ScoredPoint, error) {
+	prefetchLimit := limit * 2
+	return qClient.Query(ctx, &qdrant.QueryPoints{
+		CollectionName: CollectionName,
+		Prefetch: []*qdrant.PrefetchQuery{
+			{
+				Query:  qdrant.NewQuery(denseVector...),
+				Using:  ptr(DenseVectorName),
+				Filter: filter,
+				Limit:  &prefetchLimit,
+			},
+			{
+				Query:  qdrant.NewQuerySparse(sparseIdx, sparseVal),
+				Using:  ptr(SparseVectorName),
+				Filter: filter,
+				Limit:  &prefetchLimit,
+			},
+		},
+		Query:       qdrant.NewQueryFusion(qdrant.Fusion_RRF),
+		Limit:       &limit,
+		WithPayload: qdrant.NewWithPayload(true),
+	})
+}
+
+// weightedHybridSearch runs dense and sparse queries independently and blends
+// their scores client-side by alpha, for callers who want finer control than
+// Qdrant's built-in RRF fusion offers.
+func weightedHybridSearch(ctx context.Context, denseVector []float32, sparseIdx []uint32, sparseVal []float32, filter *qdrant.Filter, limit uint64, alpha float64) ([]*qdrant.ScoredPoint, error) {
+	prefetchLimit := limit * 2
+
+	denseResults, err := denseSearch(ctx, denseVector, filter, prefetchLimit)
+	if err != nil {
+		return nil, fmt.Errorf("dense query: %w", err)
+	}
+	sparseResults, err := sparseSearch(ctx, sparseIdx, sparseVal, filter, prefetchLimit)
+	if err != nil {
+		return nil, fmt.Errorf("sparse query: %w", err)
+	}
+
+	type merged struct {
+		point *qdrant.ScoredPoint
+		score float64
+	}
+	byID := make(map[string]*merged)
+
+	for _, p := range denseResults {
+		byID[pointKey(p)] = &merged{point: p, score: alpha * float64(p.GetScore())}
+	}
+	for _, p := range sparseResults {
+		key := pointKey(p)
+		if m, ok := byID[key]; ok {
+			m.score += (1 - alpha) * float64(p.GetScore())
+			continue
+		}
+		byID[key] = &merged{point: p, score: (1 - alpha) * float64(p.GetScore())}
+	}
+
+	all := make([]*merged, 0, len(byID))
+	for _, m := range byID {
+		all = append(all, m)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].score > all[j].score })
+
+	if uint64(len(all)) > limit {
+		all = all[:limit]
+	}
+
+	results := make([]*qdrant.ScoredPoint, len(all))
+	for i, m := range all {
+		m.point.Score = float32(m.score)
+		results[i] = m.point
+	}
+	return results, nil
+}
+
+// pointKey returns a stable identifier for deduplicating a point across the
+// separate dense and sparse result sets.
+func pointKey(p *qdrant.ScoredPoint) string {
+	return p.GetId().GetUuid()
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"hash/fnv"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/qdrant/go-client/qdrant"
+)
+
+// bm25K1 is the term-frequency saturation constant from BM25's tf component
+// (tf / (tf + k1)); we intentionally skip document-frequency and length
+// normalization since there's no persistent corpus index to draw them from.
+const bm25K1 = 1.2
+
+var (
+	alnumRe = regexp.MustCompile(`[A-Za-z0-9]+`)
+	camelRe = regexp.MustCompile(`[A-Z]+[a-z0-9]*|[a-z0-9]+`)
+)
+
+// tokenize splits source text into lowercase subword terms, breaking on
+// punctuation (which handles snake_case and dotted.identifiers) and further
+// splitting camelCase runs so "getUserID" yields "get", "user", "id".
+func tokenize(text string) []string {
+	var tokens []string
+	for _, word := range alnumRe.FindAllString(text, -1) {
+		for _, sub := range camelRe.FindAllString(word, -1) {
+			tokens = append(tokens, strings.ToLower(sub))
+		}
+	}
+	return tokens
+}
+
+// termID hashes a token into the sparse vector's index space.
+func termID(term string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(term))
+	return h.Sum32()
+}
+
+// sparseVector computes a BM25-style term-frequency sparse vector for text,
+// returning parallel index/value slices suitable for qdrant.NewVectorSparse.
+func sparseVector(text string) (indices []uint32, values []float32) {
+	freq := make(map[uint32]int)
+	for _, term := range tokenize(text) {
+		freq[termID(term)]++
+	}
+
+	indices = make([]uint32, 0, len(freq))
+	for id := range freq {
+		indices = append(indices, id)
+	}
+	sort.Slice(indices, func(i, j int) bool { return indices[i] < indices[j] })
+
+	values = make([]float32, len(indices))
+	for i, id := range indices {
+		tf := float32(freq[id])
+		values[i] = tf / (tf + bm25K1)
+	}
+
+	return indices, values
+}
+
+// namedVectors builds the dense + sparse named vector pair stored on every
+// point: dense is the Ollama embedding, sparse is a BM25-style vector over
+// text (the same chunk body the dense vector was computed from).
+func namedVectors(dense []float32, text string) *qdrant.Vectors {
+	indices, values := sparseVector(text)
+	return qdrant.NewVectorsMap(map[string]*qdrant.Vector{
+		DenseVectorName:  qdrant.NewVector(dense...),
+		SparseVectorName: qdrant.NewVectorSparse(indices, values),
+	})
+}
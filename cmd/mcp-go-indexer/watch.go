@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	"github.com/google/uuid"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/qdrant/go-client/qdrant"
+)
+
+// debounceWindow coalesces bursts of filesystem events (e.g. an editor's
+// save-via-rename) into a single reindex per file.
+const debounceWindow = 500 * time.Millisecond
+
+// projectWatcher owns one fsnotify.Watcher rooted at rootPath plus the
+// debounce state for pending reindex work.
+type projectWatcher struct {
+	rootPath string
+	watcher  *fsnotify.Watcher
+	matcher  gitignore.Matcher
+	cancel   context.CancelFunc
+
+	mu     sync.Mutex
+	timers map[string]*time.Timer
+}
+
+var (
+	watchersMu sync.Mutex
+	watchers   = map[string]*projectWatcher{}
+)
+
+// handleWatchProject starts a background fsnotify watch over the given root,
+// debouncing bursts and reindexing only the files that actually changed.
+func handleWatchProject(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	rootPath, err := request.RequireString("path")
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Path required: %v", err)), nil
+	}
+
+	watchersMu.Lock()
+	if _, exists := watchers[rootPath]; exists {
+		watchersMu.Unlock()
+		return mcp.NewToolResultError(fmt.Sprintf("Already watching %s", rootPath)), nil
+	}
+	watchersMu.Unlock()
+
+	fsWatcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to start watcher: %v", err)), nil
+	}
+
+	pw := &projectWatcher{
+		rootPath: rootPath,
+		watcher:  fsWatcher,
+		matcher:  loadGitignore(rootPath),
+		timers:   map[string]*time.Timer{},
+	}
+
+	if err := pw.addTree(rootPath); err != nil {
+		_ = fsWatcher.Close()
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to watch %s: %v", rootPath, err)), nil
+	}
+
+	watchCtx, cancel := context.WithCancel(context.Background())
+	pw.cancel = cancel
+
+	watchersMu.Lock()
+	watchers[rootPath] = pw
+	watchersMu.Unlock()
+
+	go pw.run(watchCtx)
+
+	return mcp.NewToolResultText(fmt.Sprintf("Watching %s for changes.", rootPath)), nil
+}
+
+// handleUnwatchProject stops a watch previously started by watch_project.
+func handleUnwatchProject(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	rootPath, err := request.RequireString("path")
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Path required: %v", err)), nil
+	}
+
+	watchersMu.Lock()
+	pw, exists := watchers[rootPath]
+	if exists {
+		delete(watchers, rootPath)
+	}
+	watchersMu.Unlock()
+
+	if !exists {
+		return mcp.NewToolResultError(fmt.Sprintf("Not watching %s", rootPath)), nil
+	}
+
+	pw.cancel()
+	_ = pw.watcher.Close()
+
+	return mcp.NewToolResultText(fmt.Sprintf("Stopped watching %s.", rootPath)), nil
+}
+
+// addTree registers rootPath and every non-skipped subdirectory with
+// fsnotify, which only watches one level deep per call.
+func (pw *projectWatcher) addTree(root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != root && shouldSkipDir(d.Name()) {
+			return filepath.SkipDir
+		}
+		return pw.watcher.Add(path)
+	})
+}
+
+// run pumps fsnotify events until ctx is cancelled, debouncing each affected
+// path before applying the change.
+func (pw *projectWatcher) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-pw.watcher.Events:
+			if !ok {
+				return
+			}
+			pw.handleEvent(ctx, event)
+		case err, ok := <-pw.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("Watcher error for %s: %v", pw.rootPath, err)
+		}
+	}
+}
+
+// handleEvent filters out ignored paths and (re)starts the debounce timer for
+// everything else.
+func (pw *projectWatcher) handleEvent(ctx context.Context, event fsnotify.Event) {
+	if pw.isIgnored(event.Name) {
+		return
+	}
+
+	// A newly created directory needs to be watched itself before any files
+	// dropped into it will generate events.
+	if event.Op&fsnotify.Create != 0 {
+		if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+			_ = pw.addTree(event.Name)
+			return
+		}
+	}
+
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	if timer, exists := pw.timers[event.Name]; exists {
+		timer.Stop()
+	}
+	pw.timers[event.Name] = time.AfterFunc(debounceWindow, func() {
+		pw.apply(ctx, event)
+	})
+}
+
+// apply reindexes a single changed file, or prunes its points from Qdrant on
+// removal/rename, and emits a progress notification either way.
+func (pw *projectWatcher) apply(ctx context.Context, event fsnotify.Event) {
+	pw.mu.Lock()
+	delete(pw.timers, event.Name)
+	pw.mu.Unlock()
+
+	if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+		if err := deleteFilePoints(ctx, event.Name); err != nil {
+			log.Printf("Failed to prune %s: %v", event.Name, err)
+			return
+		}
+		sendProgress(ctx, nextProgressToken(), 1, fmt.Sprintf("removed %s", event.Name))
+		return
+	}
+
+	if err := reindexFile(ctx, event.Name); err != nil {
+		log.Printf("Failed to reindex %s: %v", event.Name, err)
+		return
+	}
+	sendProgress(ctx, nextProgressToken(), 1, fmt.Sprintf("reindexed %s", event.Name))
+}
+
+// isIgnored applies the hardcoded skip list plus the project's .gitignore.
+func (pw *projectWatcher) isIgnored(path string) bool {
+	for _, part := range strings.Split(filepath.Dir(path), string(filepath.Separator)) {
+		if shouldSkipDir(part) {
+			return true
+		}
+	}
+	if pw.matcher == nil {
+		return false
+	}
+	rel, err := filepath.Rel(pw.rootPath, path)
+	if err != nil {
+		return false
+	}
+	return pw.matcher.Match(strings.Split(rel, string(filepath.Separator)), false)
+}
+
+// shouldSkipDir is the hardcoded directory skip list shared with
+// index_project's walk.
+func shouldSkipDir(name string) bool {
+	return strings.HasPrefix(name, ".") || name == "node_modules" || name == "vendor"
+}
+
+// loadGitignore reads rootPath/.gitignore, returning nil if there isn't one.
+func loadGitignore(rootPath string) gitignore.Matcher {
+	data, err := os.ReadFile(filepath.Join(rootPath, ".gitignore"))
+	if err != nil {
+		return nil
+	}
+
+	var patterns []gitignore.Pattern
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, gitignore.ParsePattern(line, nil))
+	}
+	return gitignore.NewMatcher(patterns)
+}
+
+// reindexFile re-parses a single file and upserts only the chunks whose
+// content_hash changed, then prunes any chunk previously indexed for this
+// file that's no longer present (e.g. a renamed function).
+func reindexFile(ctx context.Context, path string) error {
+	provider, ok := languageProviders[filepath.Ext(path)]
+	if !ok {
+		return nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	chunks, err := extractChunks(provider, path, content)
+	if err != nil {
+		return err
+	}
+
+	seen := make([]*qdrant.PointId, 0, len(chunks))
+	for _, chunk := range chunks {
+		uniqueID := uuid.NewSHA1(uuid.NameSpaceURL, []byte(path+":"+chunk.Kind+":"+chunk.Scope+":"+chunk.Name)).String()
+		pointID := qdrant.NewIDUUID(uniqueID)
+		seen = append(seen, pointID)
+
+		contentHash := hashContent(chunk.Body)
+		if existing, ok := fetchPoint(ctx, pointID); ok {
+			if existing.GetPayload()["content_hash"].GetStringValue() == contentHash {
+				continue
+			}
+		}
+
+		embedding, err := getOllamaEmbedding(chunk.Body)
+		if err != nil {
+			log.Printf("Embedding error for %s (%s): %v", path, chunk.Name, err)
+			continue
+		}
+
+		_, err = qClient.Upsert(ctx, &qdrant.UpsertPoints{
+			CollectionName: CollectionName,
+			Points: []*qdrant.PointStruct{
+				{
+					Id:      pointID,
+					Vectors: namedVectors(embedding, chunk.Body),
+					Payload: map[string]*qdrant.Value{
+						"file_path":    qdrant.NewValueString(path),
+						"function":     qdrant.NewValueString(chunk.Name),
+						"line_start":   qdrant.NewValueInt(int64(chunk.StartLine)),
+						"line_end":     qdrant.NewValueInt(int64(chunk.EndLine)),
+						"code_snippet": qdrant.NewValueString(chunk.Body),
+						"language":     qdrant.NewValueString(chunk.Language),
+						"kind":         qdrant.NewValueString(chunk.Kind),
+						"content_hash": qdrant.NewValueString(contentHash),
+						"indexed_at":   qdrant.NewValueString(time.Now().UTC().Format(time.RFC3339)),
+					},
+				},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("upsert %s: %w", chunk.Name, err)
+		}
+	}
+
+	_, err = qClient.Delete(ctx, &qdrant.DeletePoints{
+		CollectionName: CollectionName,
+		Points: qdrant.NewPointsSelectorFilter(&qdrant.Filter{
+			Must: []*qdrant.Condition{
+				qdrant.NewMatch("file_path", path),
+			},
+			MustNot: []*qdrant.Condition{
+				qdrant.NewHasID(seen...),
+			},
+		}),
+	})
+	return err
+}
+
+// deleteFilePoints removes every point indexed for path, used when a file is
+// removed or renamed away.
+func deleteFilePoints(ctx context.Context, path string) error {
+	_, err := qClient.Delete(ctx, &qdrant.DeletePoints{
+		CollectionName: CollectionName,
+		Points: qdrant.NewPointsSelectorFilter(&qdrant.Filter{
+			Must: []*qdrant.Condition{
+				qdrant.NewMatch("file_path", path),
+			},
+		}),
+	})
+	return err
+}